@@ -15,7 +15,9 @@ func main() {
 		Short: "Automates local repo setup using AI",
 	}
 
-	rootCmd.AddCommand(setup.RunCmd)
+	runner := setup.NewRunner()
+	rootCmd.AddCommand(setup.NewRunCmd(runner))
+	rootCmd.AddCommand(setup.NewExplainCmd(runner))
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
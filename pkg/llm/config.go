@@ -0,0 +1,51 @@
+package llm
+
+import "fmt"
+
+// Config is the `llm:` section of zup.yaml. It selects which FixProvider
+// backs a run and configures that backend.
+type Config struct {
+	// Provider selects the backend: "openai" (default), "openai-compat", or
+	// "ollama".
+	Provider string `yaml:"provider,omitempty"`
+	// BaseURL overrides the API base URL. Required for "openai-compat"
+	// (e.g. http://localhost:8080/v1 for LocalAI, vLLM, llama.cpp server);
+	// defaults to Ollama's native endpoint for "ollama".
+	BaseURL string `yaml:"base_url,omitempty"`
+	// Model is the model name passed to the backend.
+	Model string `yaml:"model,omitempty"`
+	// APIKeyEnv names the environment variable holding the API key. Defaults
+	// to OPENAI_API_KEY for "openai" and "openai-compat"; ignored by
+	// "ollama".
+	APIKeyEnv string `yaml:"api_key_env,omitempty"`
+	// Temperature is passed through to the backend's chat completion request.
+	Temperature float32 `yaml:"temperature,omitempty"`
+	// SystemPromptFile points at a text/template file (relative to the repo
+	// root) used to render the user-facing message sent to the model. When
+	// empty, each provider falls back to its built-in prompt.
+	SystemPromptFile string `yaml:"system_prompt_file,omitempty"`
+}
+
+// NewProvider constructs the FixProvider selected by cfg. A zero-value
+// Config yields the default OpenAIProvider, preserving zup's original
+// behavior for users who don't have an `llm:` section in zup.yaml.
+func NewProvider(cfg Config) (FixProvider, error) {
+	prompt, err := loadPromptTemplate(cfg.SystemPromptFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading prompt template: %w", err)
+	}
+
+	switch cfg.Provider {
+	case "", "openai":
+		return NewOpenAIProvider(cfg, prompt), nil
+	case "openai-compat":
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("llm.base_url is required for provider %q", cfg.Provider)
+		}
+		return NewOpenAICompatibleProvider(cfg, prompt), nil
+	case "ollama":
+		return NewOllamaProvider(cfg, prompt), nil
+	default:
+		return nil, fmt.Errorf("unknown llm.provider %q", cfg.Provider)
+	}
+}
@@ -0,0 +1,117 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+const defaultOllamaBaseURL = "http://localhost:11434"
+
+// OllamaProvider suggests fixes using Ollama's native /api/chat endpoint
+// rather than its OpenAI-compatible shim, so it works against older Ollama
+// builds too.
+type OllamaProvider struct {
+	httpClient  *http.Client
+	baseURL     string
+	model       string
+	temperature float32
+	prompt      *template.Template
+}
+
+// NewOllamaProvider builds an OllamaProvider from cfg. cfg.BaseURL defaults
+// to Ollama's standard local address.
+func NewOllamaProvider(cfg Config, prompt *template.Template) *OllamaProvider {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = defaultOllamaBaseURL
+	}
+	return &OllamaProvider{
+		httpClient:  &http.Client{Timeout: 60 * time.Second},
+		baseURL:     baseURL,
+		model:       cfg.Model,
+		temperature: cfg.Temperature,
+		prompt:      prompt,
+	}
+}
+
+type ollamaChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ollamaChatRequest struct {
+	Model    string              `json:"model"`
+	Messages []ollamaChatMessage `json:"messages"`
+	Format   string              `json:"format"`
+	Stream   bool                `json:"stream"`
+	Options  struct {
+		Temperature float32 `json:"temperature"`
+	} `json:"options"`
+}
+
+type ollamaChatResponse struct {
+	Message ollamaChatMessage `json:"message"`
+}
+
+// GetFix implements FixProvider.
+func (p *OllamaProvider) GetFix(ctx context.Context, req FixRequest) (FixResult, error) {
+	userContent, err := renderPrompt(p.prompt, req)
+	if err != nil {
+		return FixResult{}, fmt.Errorf("rendering prompt: %w", err)
+	}
+
+	messages := make([]ollamaChatMessage, 0, len(req.History)+2)
+	messages = append(messages, ollamaChatMessage{
+		Role:    "system",
+		Content: "You are a terminal assistant. Reply with JSON: {\"fix\": string, \"explanation\": string}.",
+	})
+	for _, m := range req.History {
+		messages = append(messages, ollamaChatMessage{Role: m.Role, Content: m.Content})
+	}
+	messages = append(messages, ollamaChatMessage{Role: "user", Content: userContent})
+
+	reqBody := ollamaChatRequest{
+		Model:    p.model,
+		Messages: messages,
+		Format:   "json",
+		Stream:   false,
+	}
+	reqBody.Options.Temperature = p.temperature
+
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return FixResult{}, fmt.Errorf("encoding request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return FixResult{}, fmt.Errorf("building request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return FixResult{}, fmt.Errorf("contacting ollama: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return FixResult{}, fmt.Errorf("ollama returned status %d", resp.StatusCode)
+	}
+
+	var chatResp ollamaChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+		return FixResult{}, fmt.Errorf("decoding ollama response: %w", err)
+	}
+
+	var result FixResult
+	if err := json.Unmarshal([]byte(chatResp.Message.Content), &result); err != nil {
+		return FixResult{}, fmt.Errorf("invalid JSON from ollama: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,228 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// fixFunctionTools is the single-function tool definition used to force a
+// structured {fix, explanation} response out of chat-completion models.
+var fixFunctionTools = []openai.Tool{
+	{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        "suggest_fix",
+			Description: "Suggest a terminal command to fix a given error",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"fix": map[string]string{
+						"type":        "string",
+						"description": "The terminal command to fix the issue",
+					},
+					"explanation": map[string]string{
+						"type":        "string",
+						"description": "Explanation of why this fix works",
+					},
+				},
+				"required": []string{"fix", "explanation"},
+			},
+		},
+	},
+}
+
+// OpenAIProvider suggests fixes using OpenAI's hosted chat completion API.
+type OpenAIProvider struct {
+	client      *openai.Client
+	model       string
+	temperature float32
+	prompt      *template.Template
+}
+
+// NewOpenAIProvider builds an OpenAIProvider from cfg. The API key is read
+// from cfg.APIKeyEnv, defaulting to OPENAI_API_KEY.
+func NewOpenAIProvider(cfg Config, prompt *template.Template) *OpenAIProvider {
+	apiKey := os.Getenv(apiKeyEnv(cfg))
+	model := cfg.Model
+	if model == "" {
+		model = openai.GPT4
+	}
+	return &OpenAIProvider{
+		client:      openai.NewClient(apiKey),
+		model:       model,
+		temperature: cfg.Temperature,
+		prompt:      prompt,
+	}
+}
+
+// GetFix implements FixProvider.
+func (p *OpenAIProvider) GetFix(ctx context.Context, req FixRequest) (FixResult, error) {
+	return chatFix(ctx, p.client, p.model, p.temperature, p.prompt, req)
+}
+
+// GetFixStream implements StreamingFixProvider.
+func (p *OpenAIProvider) GetFixStream(ctx context.Context, req FixRequest, onDelta func(StreamDelta)) (FixResult, error) {
+	return chatFixStream(ctx, p.client, p.model, p.temperature, p.prompt, req, onDelta)
+}
+
+// OpenAICompatibleProvider suggests fixes using any server that implements
+// the OpenAI chat completion API under a custom base URL: LocalAI, Ollama's
+// OpenAI-compatible endpoint, vLLM, llama.cpp server, etc.
+type OpenAICompatibleProvider struct {
+	client      *openai.Client
+	model       string
+	temperature float32
+	prompt      *template.Template
+}
+
+// NewOpenAICompatibleProvider builds an OpenAICompatibleProvider from cfg.
+// cfg.BaseURL is required; the API key is optional since most local servers
+// don't check it.
+func NewOpenAICompatibleProvider(cfg Config, prompt *template.Template) *OpenAICompatibleProvider {
+	clientCfg := openai.DefaultConfig(os.Getenv(apiKeyEnv(cfg)))
+	clientCfg.BaseURL = cfg.BaseURL
+	return &OpenAICompatibleProvider{
+		client:      openai.NewClientWithConfig(clientCfg),
+		model:       cfg.Model,
+		temperature: cfg.Temperature,
+		prompt:      prompt,
+	}
+}
+
+// GetFix implements FixProvider.
+func (p *OpenAICompatibleProvider) GetFix(ctx context.Context, req FixRequest) (FixResult, error) {
+	return chatFix(ctx, p.client, p.model, p.temperature, p.prompt, req)
+}
+
+// GetFixStream implements StreamingFixProvider. Backends that don't support
+// streaming (some older LocalAI builds) return an error on the first chunk;
+// callers should fall back to GetFix in that case.
+func (p *OpenAICompatibleProvider) GetFixStream(ctx context.Context, req FixRequest, onDelta func(StreamDelta)) (FixResult, error) {
+	return chatFixStream(ctx, p.client, p.model, p.temperature, p.prompt, req, onDelta)
+}
+
+// apiKeyEnv returns the environment variable to read the API key from,
+// defaulting to OPENAI_API_KEY.
+func apiKeyEnv(cfg Config) string {
+	if cfg.APIKeyEnv != "" {
+		return cfg.APIKeyEnv
+	}
+	return "OPENAI_API_KEY"
+}
+
+// chatMessages builds the full message list for req: a system prompt,
+// followed by any prior repair-conversation turns in req.History, followed
+// by the current attempt rendered from prompt.
+func chatMessages(prompt *template.Template, req FixRequest) ([]openai.ChatCompletionMessage, error) {
+	userContent, err := renderPrompt(prompt, req)
+	if err != nil {
+		return nil, fmt.Errorf("rendering prompt: %w", err)
+	}
+
+	messages := make([]openai.ChatCompletionMessage, 0, len(req.History)+2)
+	messages = append(messages, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: "You are a terminal assistant that always suggests shell command fixes.",
+	})
+	for _, m := range req.History {
+		messages = append(messages, openai.ChatCompletionMessage{Role: m.Role, Content: m.Content})
+	}
+	messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: userContent})
+	return messages, nil
+}
+
+// chatFix sends req through the OpenAI chat completion + tool-calling API
+// and decodes the resulting suggest_fix call. It's shared by OpenAIProvider
+// and OpenAICompatibleProvider since both speak the same wire protocol.
+func chatFix(ctx context.Context, client *openai.Client, model string, temperature float32, prompt *template.Template, req FixRequest) (FixResult, error) {
+	messages, err := chatMessages(prompt, req)
+	if err != nil {
+		return FixResult{}, err
+	}
+
+	resp, err := client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:       model,
+		Temperature: temperature,
+		Messages:    messages,
+		Tools:       fixFunctionTools,
+		ToolChoice: openai.ToolChoice{
+			Type: openai.ToolTypeFunction,
+			Function: openai.ToolFunction{
+				Name: "suggest_fix",
+			},
+		},
+	})
+	if err != nil {
+		return FixResult{}, fmt.Errorf("contacting backend: %w", err)
+	}
+	if len(resp.Choices) == 0 || len(resp.Choices[0].Message.ToolCalls) == 0 {
+		return FixResult{}, fmt.Errorf("backend returned no tool call")
+	}
+
+	var result FixResult
+	toolCall := resp.Choices[0].Message.ToolCalls[0]
+	if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &result); err != nil {
+		return FixResult{}, fmt.Errorf("invalid JSON from backend: %w", err)
+	}
+	return result, nil
+}
+
+// chatFixStream is the streaming counterpart to chatFix. It accumulates the
+// tool call's function.arguments delta across chunks, reporting the "fix"
+// field to onDelta as soon as enough of it has arrived to decode, and
+// finalizing "explanation" once the stream closes and the full JSON is
+// valid.
+func chatFixStream(ctx context.Context, client *openai.Client, model string, temperature float32, prompt *template.Template, req FixRequest, onDelta func(StreamDelta)) (FixResult, error) {
+	messages, err := chatMessages(prompt, req)
+	if err != nil {
+		return FixResult{}, err
+	}
+
+	stream, err := client.CreateChatCompletionStream(ctx, openai.ChatCompletionRequest{
+		Model:       model,
+		Temperature: temperature,
+		Messages:    messages,
+		Tools:       fixFunctionTools,
+		ToolChoice: openai.ToolChoice{
+			Type: openai.ToolTypeFunction,
+			Function: openai.ToolFunction{
+				Name: "suggest_fix",
+			},
+		},
+	})
+	if err != nil {
+		return FixResult{}, fmt.Errorf("opening stream: %w", err)
+	}
+	defer stream.Close()
+
+	var argsBuf strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return FixResult{}, fmt.Errorf("reading stream: %w", err)
+		}
+		if len(chunk.Choices) == 0 || len(chunk.Choices[0].Delta.ToolCalls) == 0 {
+			continue
+		}
+		argsBuf.WriteString(chunk.Choices[0].Delta.ToolCalls[0].Function.Arguments)
+		onDelta(StreamDelta{Fix: partialFix(argsBuf.String())})
+	}
+
+	var result FixResult
+	if err := json.Unmarshal([]byte(argsBuf.String()), &result); err != nil {
+		return FixResult{}, fmt.Errorf("invalid JSON from backend: %w", err)
+	}
+	onDelta(StreamDelta{Fix: result.Fix, Explanation: result.Explanation})
+	return result, nil
+}
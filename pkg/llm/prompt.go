@@ -0,0 +1,38 @@
+package llm
+
+import (
+	"os"
+	"strings"
+	"text/template"
+)
+
+// defaultPromptText is used when a provider has no system_prompt_file
+// configured. It mirrors the message zup has always sent to OpenAI.
+const defaultPromptText = `I ran this command: {{.Command}}
+It failed with this error: {{.ErrorMsg}}
+I am on this OS: {{.OS}}.
+{{- if .Meta}}
+Note: {{.Meta}}
+{{- end}}`
+
+// loadPromptTemplate parses the template at path, or the built-in default
+// when path is empty.
+func loadPromptTemplate(path string) (*template.Template, error) {
+	if path == "" {
+		return template.New("fix").Parse(defaultPromptText)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return template.New("fix").Parse(string(data))
+}
+
+// renderPrompt fills tmpl with req, returning the rendered user message.
+func renderPrompt(tmpl *template.Template, req FixRequest) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, req); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,48 @@
+// Package llm provides pluggable backends for generating fix suggestions
+// in response to failed shell commands. A FixProvider hides the details of
+// which API (OpenAI, an OpenAI-compatible server, or Ollama) is used to
+// produce a suggestion, so the rest of zup only ever talks to the interface.
+package llm
+
+import "context"
+
+// Message is a single turn of a chat conversation, independent of any
+// specific backend's SDK types.
+type Message struct {
+	// Role is one of "system", "user", or "assistant".
+	Role    string
+	Content string
+}
+
+// FixRequest carries everything a FixProvider needs to suggest a fix for a
+// failed command.
+type FixRequest struct {
+	// Command is the shell command that was attempted.
+	Command string
+	// ErrorMsg is the error output produced by running Command.
+	ErrorMsg string
+	// Meta is an optional free-form note supplied by the step author to
+	// steer the suggestion.
+	Meta string
+	// OS is the runtime.GOOS of the machine running zup.
+	OS string
+	// History is the prior turns of a multi-attempt repair conversation for
+	// this step, oldest first. It's sent ahead of the rendered Command/
+	// ErrorMsg/Meta turn so the model can see what was already tried. Empty
+	// on a step's first attempt.
+	History []Message
+}
+
+// FixResult is a suggested fix for a FixRequest.
+type FixResult struct {
+	Fix         string
+	Explanation string
+}
+
+// FixProvider suggests a shell command fix for a failed command. Each
+// implementation is responsible for talking to its own backend (OpenAI, an
+// OpenAI-compatible server, Ollama, ...) and translating the response into a
+// FixResult.
+type FixProvider interface {
+	GetFix(ctx context.Context, req FixRequest) (FixResult, error)
+}
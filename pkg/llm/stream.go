@@ -0,0 +1,49 @@
+package llm
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+)
+
+// StreamDelta is one incremental update of a fix suggestion as it streams
+// in. Fix is the best-effort decoded value so far; Explanation is only
+// populated once the stream has closed and the full JSON payload could be
+// decoded.
+type StreamDelta struct {
+	Fix         string
+	Explanation string
+}
+
+// StreamingFixProvider is implemented by FixProviders that can render a fix
+// suggestion incrementally instead of blocking until the full response
+// arrives. onDelta is called with the cumulative StreamDelta each time new
+// content is available.
+type StreamingFixProvider interface {
+	FixProvider
+	GetFixStream(ctx context.Context, req FixRequest, onDelta func(StreamDelta)) (FixResult, error)
+}
+
+// fixFieldPattern extracts the value of the "fix" key from a partial
+// (possibly truncated) JSON object of the shape {"fix": "...", "explanation": "..."}.
+// It's deliberately lenient: it matches as soon as the opening quote after
+// "fix": is seen and keeps matching through escaped characters, so it can be
+// re-run against a growing buffer and report whatever prefix of the value is
+// currently decodable.
+var fixFieldPattern = regexp.MustCompile(`"fix"\s*:\s*"((?:[^"\\]|\\.)*)`)
+
+// partialFix decodes the "fix" field out of a partial JSON buffer, returning
+// as much of the string as has been unescaped so far.
+func partialFix(buf string) string {
+	m := fixFieldPattern.FindStringSubmatch(buf)
+	if m == nil {
+		return ""
+	}
+	unescaped, err := strconv.Unquote(`"` + m[1] + `"`)
+	if err != nil {
+		// The buffer ends mid-escape-sequence; fall back to the raw
+		// (still useful) prefix rather than dropping it.
+		return m[1]
+	}
+	return unescaped
+}
@@ -0,0 +1,74 @@
+package setup
+
+import (
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// NewExplainCmd builds the `zup explain <step>` command bound to r, which
+// replays a step's saved repair conversation for debugging why the model
+// suggested what it did across a run's retries.
+func NewExplainCmd(r *Runner) *cobra.Command {
+	return &cobra.Command{
+		Use:   "explain <step>",
+		Short: "Replay the saved repair conversation for a step in zup.yaml",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			r.explainStep(args[0])
+		},
+	}
+}
+
+/*
+explainStep looks up the step in zup.yaml whose description matches desc,
+loads its persisted RepairSession from .zup/history, and prints the
+conversation turn by turn. If the step has never failed (or zup was never
+run with history enabled), it reports that no history was found.
+*/
+func (r *Runner) explainStep(desc string) {
+	cfg, err := loadConfig("zup.yaml")
+	if err != nil {
+		fmt.Fprintln(r.Output, "Failed to load zup.yaml:", err)
+		return
+	}
+
+	step, ok := findStep(cfg.Setup, desc)
+	if !ok {
+		fmt.Fprintf(r.Output, "No step with desc %q found in zup.yaml\n", desc)
+		return
+	}
+
+	session, err := LoadRepairSession(step)
+	if err != nil {
+		fmt.Fprintln(r.Output, "Failed to load repair history:", err)
+		return
+	}
+	if len(session.Messages) == 0 {
+		fmt.Fprintf(r.Output, "No repair history recorded for step %q\n", step.Desc)
+		return
+	}
+
+	cyan := color.New(color.FgCyan, color.Bold)
+	yellow := color.New(color.FgYellow, color.Bold)
+	for _, m := range session.Messages {
+		switch m.Role {
+		case "assistant":
+			yellow.Fprint(r.Output, "\nassistant: ")
+		default:
+			cyan.Fprintf(r.Output, "\n%s: ", m.Role)
+		}
+		fmt.Fprintln(r.Output, m.Content)
+	}
+}
+
+// findStep returns the first step in steps whose Desc matches desc.
+func findStep(steps []Step, desc string) (Step, bool) {
+	for _, s := range steps {
+		if s.Desc == desc {
+			return s, true
+		}
+	}
+	return Step{}, false
+}
@@ -0,0 +1,115 @@
+package setup
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CommandExecutor runs shell commands and probes the PATH for binaries. It
+// exists so tests can exercise the retry/fix loop without spawning real
+// processes.
+type CommandExecutor interface {
+	// Run executes command via bash -c. When suppressOutput is true,
+	// stdout/stderr are captured and folded into the returned error instead
+	// of being streamed to the terminal.
+	Run(command string, suppressOutput bool) error
+	// LookPath reports whether binary is available on the PATH, mirroring
+	// exec.LookPath.
+	LookPath(binary string) (string, error)
+}
+
+// UserPrompter asks the user yes/no questions. It exists so tests can script
+// responses instead of reading real stdin.
+type UserPrompter interface {
+	Confirm(prompt string) bool
+}
+
+// Clock abstracts time so tests can skip real waits. It exists so tests can
+// drive waitForBinary retries without actually sleeping.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// execExecutor is the CommandExecutor used outside of tests: it runs
+// commands for real via bash -c.
+type execExecutor struct{}
+
+func (execExecutor) Run(command string, suppressOutput bool) error {
+	cmd := exec.Command("bash", "-c", command)
+	cmd.Stdin = os.Stdin
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if !suppressOutput {
+		cmd.Stdout = os.Stdout
+	}
+	if err := cmd.Run(); err != nil {
+		if suppressOutput {
+			return errors.New(strings.TrimSpace(stdout.String() + "\n" + stderr.String()))
+		}
+		return errors.New(stderr.String())
+	}
+	if !suppressOutput && stdout.Len() > 0 {
+		io.Copy(os.Stdout, &stdout)
+	}
+	return nil
+}
+
+func (execExecutor) LookPath(binary string) (string, error) {
+	return exec.LookPath(binary)
+}
+
+// stdinPrompter is the UserPrompter used outside of tests: it reads
+// yes/no answers from an io.Reader (os.Stdin in production). It doesn't
+// print prompt itself — callers own a Runner's Output (and, for grouped
+// steps, its "[desc]"-prefixed writer), so they print the prompt there
+// before calling Confirm.
+type stdinPrompter struct {
+	in io.Reader
+}
+
+func (p stdinPrompter) Confirm(prompt string) bool {
+	scanner := bufio.NewScanner(p.in)
+	scanner.Scan()
+	resp := strings.ToLower(scanner.Text())
+	return resp == "y" || resp == "yes"
+}
+
+// realClock is the Clock used outside of tests.
+type realClock struct{}
+
+func (realClock) Now() time.Time        { return time.Now() }
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// prefixWriter prefixes every line written to it with prefix before
+// forwarding to out, guarding each write with mu so concurrent writers
+// (e.g. steps in the same group) don't tear each other's lines.
+type prefixWriter struct {
+	out    io.Writer
+	prefix string
+	mu     *sync.Mutex
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	lines := strings.Split(string(p), "\n")
+	for i, line := range lines {
+		if line == "" && i == len(lines)-1 {
+			continue
+		}
+		if _, err := fmt.Fprintf(w.out, "%s %s\n", w.prefix, line); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
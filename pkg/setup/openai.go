@@ -2,108 +2,112 @@ package setup
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"os"
 	"runtime"
 	"time"
 
+	"zup/pkg/llm"
+
 	"github.com/briandowns/spinner"
-	"github.com/sashabaranov/go-openai"
+	"github.com/fatih/color"
 )
 
 /*
-getFixFromOpenAIWithMeta queries OpenAI's GPT-4 API using function calling to suggest a fix for a failed shell command.
+getFix asks r.FixProvider for a suggested fix for a failed shell command.
 
 Arguments:
+- session: The repair conversation for this step so far; its Messages are sent ahead of the current turn so the model sees what was already tried.
 - command: The shell command that was attempted.
 - errorMsg: The error message received from running the command.
-- meta: Optional additional context or notes to help OpenAI provide a better fix.
+- meta: Optional additional context or notes to help the backend provide a better fix.
 
 Returns:
-- fix: A shell command string suggested by OpenAI to fix the error.
+- fix: A shell command string suggested by the backend to fix the error.
 - explanation: A human-readable explanation of the fix.
 
-This function constructs a prompt including the command, error, OS, and meta note, sends it to OpenAI using the
-function calling (tool use) interface, and expects a structured JSON response with 'fix' and 'explanation' fields.
-The use of OpenAI's ToolChoiceFunction ensures reliable and valid JSON output.
+If r.FixProvider hasn't been configured (e.g. in a Runner built directly
+rather than via NewRunner+runSetup), it falls back to the default
+OpenAI-backed provider. When the provider supports streaming and r.NoStream
+wasn't set, the fix is rendered to r.Output as it's composed, replacing the
+spinner in place; otherwise getFix blocks until the full response arrives.
+Grouped steps (see Runner.grouped) always take the blocking path with the
+spinner animation disabled, since both the stream and the spinner write in
+small newline-less chunks that the group's line-prefixing writer would
+otherwise mangle.
 */
-
-func getFixFromOpenAIWithMeta(command, errorMsg, meta string) (string, string) {
-	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
-	s.Suffix = " 🧠 Thinking for a fix..."
-	s.Start()
-
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		return "", "Missing OPENAI_API_KEY"
+func (r *Runner) getFix(session *RepairSession, command, errorMsg, meta string) (string, string) {
+	provider := r.FixProvider
+	if provider == nil {
+		var err error
+		provider, err = llm.NewProvider(llm.Config{})
+		if err != nil {
+			return "", fmt.Sprintf("Failed to configure llm provider: %v", err)
+		}
 	}
 
-	client := openai.NewClient(apiKey)
-	ctx := context.Background()
-
-	userOs := runtime.GOOS
-	userContent := fmt.Sprintf(
-		"I ran this command: %s\nIt failed with this error: %s\nI am on this OS: %s.",
-		command, errorMsg, userOs,
-	)
-	if meta != "" {
-		userContent += fmt.Sprintf("\nNote: %s", meta)
+	req := llm.FixRequest{
+		Command:  command,
+		ErrorMsg: errorMsg,
+		Meta:     meta,
+		OS:       runtime.GOOS,
+		History:  session.Messages,
 	}
 
-	tools := []openai.Tool{
-		{
-			Type: openai.ToolTypeFunction,
-			Function: &openai.FunctionDefinition{
-				Name:        "suggest_fix",
-				Description: "Suggest a terminal command to fix a given error",
-				Parameters: map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"fix": map[string]string{
-							"type":        "string",
-							"description": "The terminal command to fix the issue",
-						},
-						"explanation": map[string]string{
-							"type":        "string",
-							"description": "Explanation of why this fix works",
-						},
-					},
-					"required": []string{"fix", "explanation"},
-				},
-			},
-		},
+	grouped := r.grouped()
+	streamer, ok := provider.(llm.StreamingFixProvider)
+	if ok && !r.NoStream && !grouped {
+		return r.getFixStreamed(streamer, req)
 	}
 
-	resp, err := client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model: openai.GPT4,
-		Messages: []openai.ChatCompletionMessage{
-			{Role: openai.ChatMessageRoleSystem, Content: "You are a terminal assistant that always suggests shell command fixes."},
-			{Role: openai.ChatMessageRoleUser, Content: userContent},
-		},
-		Tools: tools,
-		ToolChoice: openai.ToolChoice(openai.ToolChoice{
-			Type: openai.ToolTypeFunction,
-			Function: openai.ToolFunction{
-				Name: "suggest_fix",
-			},
-		}),
-	})
-	if err != nil {
+	var s *spinner.Spinner
+	if grouped {
+		fmt.Fprintln(r.Output, "🧠 Thinking for a fix...")
+	} else {
+		s = spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(r.Output))
+		s.Suffix = " 🧠 Thinking for a fix..."
+		s.Start()
+	}
+	result, err := provider.GetFix(context.Background(), req)
+	if s != nil {
 		s.Stop()
-		return "", fmt.Sprintf("Failed to contact OpenAI: %v", err)
 	}
+	if err != nil {
+		return "", fmt.Sprintf("Failed to get fix: %v", err)
+	}
+	color.New(color.FgYellow, color.Bold).Fprintf(r.Output, "\n💡 Suggested Fix: %s\n", result.Fix)
+	return result.Fix, result.Explanation
+}
 
-	toolCall := resp.Choices[0].Message.ToolCalls[0]
-	var result struct {
-		Fix         string `json:"fix"`
-		Explanation string `json:"explanation"`
+// getFixStreamed renders a fix suggestion to r.Output as it streams in,
+// replacing the spinner line with the growing "fix" text. It falls back to
+// the streamer's blocking GetFix if the stream errors out before producing
+// anything, so backends that advertise streaming support but don't
+// implement it cleanly (older LocalAI builds) still degrade gracefully.
+func (r *Runner) getFixStreamed(streamer llm.StreamingFixProvider, req llm.FixRequest) (string, string) {
+	yellow := color.New(color.FgYellow, color.Bold)
+	printed := 0
+	result, err := streamer.GetFixStream(context.Background(), req, func(delta llm.StreamDelta) {
+		if printed == 0 {
+			yellow.Fprint(r.Output, "\n💡 Suggested Fix: ")
+		}
+		if len(delta.Fix) > printed {
+			fmt.Fprint(r.Output, delta.Fix[printed:])
+			printed = len(delta.Fix)
+		}
+	})
+	if err != nil {
+		if printed > 0 {
+			fmt.Fprintln(r.Output)
+		}
+		fallback, fErr := streamer.GetFix(context.Background(), req)
+		if fErr != nil {
+			return "", fmt.Sprintf("Failed to get fix: %v", err)
+		}
+		color.New(color.FgYellow, color.Bold).Fprintf(r.Output, "\n💡 Suggested Fix: %s\n", fallback.Fix)
+		return fallback.Fix, fallback.Explanation
 	}
-	if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &result); err != nil {
-		s.Stop()
-		return "", fmt.Sprintf("Invalid OpenAI JSON format: %v", err)
+	if printed > 0 {
+		fmt.Fprintln(r.Output)
 	}
-
-	s.Stop()
 	return result.Fix, result.Explanation
 }
@@ -1,15 +1,15 @@
 package setup
 
 import (
-	"bufio"
-	"bytes"
-	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"strings"
+	"sync"
 	"time"
 
+	"zup/pkg/llm"
+
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
@@ -20,12 +20,32 @@ type Step struct {
 	Desc string `yaml:"desc"`
 	Cmd  string `yaml:"cmd"`
 	Meta string `yaml:"meta,omitempty"`
+	// Mode selects how Cmd is executed: "same-terminal" (default),
+	// "background", "dry-run", or "sandbox".
 	Mode string `yaml:"mode,omitempty"`
+	// Image is the Docker image used when Mode is "sandbox".
+	Image string `yaml:"image,omitempty"`
+	// Network controls sandbox networking. Set to "none" to run the
+	// container without network access; empty keeps Docker's default.
+	Network string `yaml:"network,omitempty"`
+	// Group, when set, runs this step concurrently with every other step
+	// sharing the same Group value, as a batch. Execution still waits for
+	// the whole batch before moving on to the next non-grouped step.
+	Group string `yaml:"group,omitempty"`
+}
+
+// execOptions controls how a single command is executed, independent of
+// which step (or step retry) it came from.
+type execOptions struct {
+	Mode    string
+	Image   string
+	Network string
 }
 
 // Config represents the overall YAML configuration.
 type Config struct {
-	Setup []Step `yaml:"setup"`
+	Setup []Step     `yaml:"setup"`
+	LLM   llm.Config `yaml:"llm,omitempty"`
 }
 
 // FixResponse represents the structure of a fix suggestion from OpenAI.
@@ -34,29 +54,166 @@ type FixResponse struct {
 	Explanation string `json:"explanation"`
 }
 
-// RunCmd is the main Cobra command for running the setup. It loads the YAML configuration and executes all setup steps defined in zup.yaml.
-var RunCmd = &cobra.Command{
-	Use:   "run",
-	Short: "Run setup steps defined in zup.yaml",
-	Run: func(cmd *cobra.Command, args []string) {
-		runSetup()
-	},
+// Runner holds everything fixAndRunCommandWithMeta and its callees need to
+// execute a setup: how to run commands, how to ask the user for
+// confirmation, how to suggest fixes, where to print, and how to tell time.
+// Constructing one explicitly (rather than reaching for package-level
+// globals and os.Stdin/exec.Command directly) is what lets tests drive the
+// retry/fix loop without spawning real processes or calling OpenAI.
+type Runner struct {
+	Executor    CommandExecutor
+	Prompter    UserPrompter
+	FixProvider llm.FixProvider
+	Output      io.Writer
+	Clock       Clock
+
+	// NoStream disables streaming fix suggestions, set via the --no-stream
+	// flag.
+	NoStream bool
+	// Resume loads each step's prior repair conversation from .zup/history
+	// instead of starting fresh, set via the --resume flag.
+	Resume bool
+
+	// promptMu serializes r.Prompter.Confirm across steps running
+	// concurrently in the same group, so their prompts don't interleave.
+	// outputMu serializes writes to Output from those same steps. Both are
+	// pointers so that per-step Runner copies (see withOutput) share them.
+	promptMu *sync.Mutex
+	outputMu *sync.Mutex
+}
+
+// NewRunner builds the production Runner: real process execution, stdin
+// prompts, and the real clock. FixProvider is left nil and resolved from
+// zup.yaml's `llm:` section the first time Run is called.
+func NewRunner() *Runner {
+	return &Runner{
+		Executor: execExecutor{},
+		Prompter: stdinPrompter{in: os.Stdin},
+		Output:   os.Stdout,
+		Clock:    realClock{},
+		promptMu: &sync.Mutex{},
+		outputMu: &sync.Mutex{},
+	}
+}
+
+// withOutput returns a shallow copy of r writing to w instead of r.Output,
+// sharing the same promptMu/outputMu so concurrent copies (one per grouped
+// step) still serialize prompts and don't tear writes to the underlying
+// terminal.
+func (r *Runner) withOutput(w io.Writer) *Runner {
+	cp := *r
+	cp.Output = w
+	return &cp
+}
+
+// grouped reports whether r is a per-step copy executeGroupedStep made for
+// a step running alongside others in the same group, i.e. whether r.Output
+// is a prefixWriter multiplexing several steps' output onto one terminal.
+// Streamed fix tokens and the spinner's carriage-return animation are both
+// made of many small, newline-less writes; prefixWriter's line-based
+// prefixing re-emits every such write as its own "[desc] ..." line, so
+// grouped steps render a fix one token (or spinner frame) per line instead
+// of one coherent line. getFix uses this to fall back to a single static
+// "thinking" line and the plain, one-shot GetFix response when grouped.
+func (r *Runner) grouped() bool {
+	_, ok := r.Output.(*prefixWriter)
+	return ok
+}
+
+// NewRunCmd builds the `zup run` command bound to r.
+func NewRunCmd(r *Runner) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "run",
+		Short: "Run setup steps defined in zup.yaml",
+		Run: func(cmd *cobra.Command, args []string) {
+			r.runSetup()
+		},
+	}
+	cmd.Flags().BoolVar(&r.NoStream, "no-stream", false, "Disable streaming fix suggestions (wait for the full response instead)")
+	cmd.Flags().BoolVar(&r.Resume, "resume", false, "Resume each step's repair conversation from .zup/history instead of starting fresh")
+	return cmd
 }
 
 /*
 runSetup is the entry point for executing the setup process as defined in the YAML configuration file (zup.yaml).
 
-This function attempts to load the configuration file, parse its contents into a Config struct, and then iterates over each setup step defined in the file. For each step, it delegates execution to the executeStep function, which handles command execution and error recovery. If the configuration file cannot be loaded or parsed, an error message is printed and the setup process is aborted.
+This function attempts to load the configuration file, parse its contents into a Config struct, resolve the llm.FixProvider it describes, and then iterates over each setup step defined in the file. For each step, it delegates execution to executeStep, which handles command execution and error recovery. If the configuration file cannot be loaded or parsed, an error message is printed and the setup process is aborted.
 */
-func runSetup() {
+func (r *Runner) runSetup() {
 	cfg, err := loadConfig("zup.yaml")
 	if err != nil {
-		fmt.Println("Failed to load zup.yaml:", err)
+		fmt.Fprintln(r.Output, "Failed to load zup.yaml:", err)
 		return
 	}
-	for _, step := range cfg.Setup {
-		executeStep(step)
+
+	if r.FixProvider == nil {
+		r.FixProvider, err = llm.NewProvider(cfg.LLM)
+		if err != nil {
+			fmt.Fprintln(r.Output, "Failed to configure llm provider:", err)
+			return
+		}
+	}
+
+	steps := cfg.Setup
+	for i := 0; i < len(steps); {
+		if steps[i].Group == "" {
+			r.executeStep(steps[i])
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(steps) && steps[j].Group == steps[i].Group {
+			j++
+		}
+		r.executeGroup(steps[i:j])
+		i = j
+	}
+}
+
+// groupWorkerPoolSize bounds how many steps in a group run concurrently.
+const groupWorkerPoolSize = 8
+
+/*
+executeGroup runs a batch of steps sharing the same Group concurrently via a
+worker pool, multiplexing their output with a "[step desc]" prefix so
+interleaved lines stay attributable, and blocks until the whole batch
+finishes before returning (the barrier before the next non-grouped step).
+*/
+func (r *Runner) executeGroup(steps []Step) {
+	color.New(color.FgCyan, color.Bold).Fprintf(r.Output, "\n▶ Running group %q (%d steps in parallel)\n", steps[0].Group, len(steps))
+
+	workers := len(steps)
+	if workers > groupWorkerPoolSize {
+		workers = groupWorkerPoolSize
+	}
+	jobs := make(chan Step)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for step := range jobs {
+				r.executeGroupedStep(step)
+			}
+		}()
 	}
+	for _, step := range steps {
+		jobs <- step
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// executeGroupedStep runs step through executeStep with its output prefixed
+// by step's description, using a Runner copy so the original r is
+// untouched.
+func (r *Runner) executeGroupedStep(step Step) {
+	prefixed := r.withOutput(&prefixWriter{
+		out:    r.Output,
+		prefix: fmt.Sprintf("[%s]", step.Desc),
+		mu:     r.outputMu,
+	})
+	prefixed.executeStep(step)
 }
 
 /*
@@ -79,47 +236,83 @@ func loadConfig(path string) (*Config, error) {
 executeStep is responsible for running a single setup step as defined in the configuration.
 It prints the step's description and command to the terminal for user visibility. The function then attempts to execute the command using fixAndRunCommandWithMeta, which handles both normal execution and error recovery. If the command fails and cannot be fixed, an error message is displayed. This function ensures that each step is clearly communicated to the user and that failures are handled gracefully.
 */
-func executeStep(step Step) {
+func (r *Runner) executeStep(step Step) {
 	mode := step.Mode
 	if mode == "" {
 		mode = "same-terminal"
 	}
 	cyan := color.New(color.FgCyan, color.Bold).SprintFunc()
-	fmt.Printf("\n%s %s\n%s %s\n",
+	fmt.Fprintf(r.Output, "\n%s %s\n%s %s\n",
 		cyan("🔧 Step:"), step.Desc,
 		cyan("Command:"), step.Cmd,
 	)
-	if err := fixAndRunCommandWithMeta(step.Cmd, step.Meta, mode); err != nil {
-		color.New(color.FgRed, color.Bold).Printf("\n❌ Command ultimately failed after all fixes: %v\n", err)
+
+	var session *RepairSession
+	var err error
+	if r.Resume {
+		session, err = LoadRepairSession(step)
+	} else {
+		session = NewRepairSession(step)
+	}
+	if err != nil {
+		color.New(color.FgRed, color.Bold).Fprintf(r.Output, "\n❌ Failed to load repair history: %v\n", err)
+		session = NewRepairSession(step)
+	}
+
+	opts := execOptions{Mode: mode, Image: step.Image, Network: step.Network}
+	if err := r.fixAndRunCommandWithMeta(step.Cmd, step.Meta, opts, session); err != nil {
+		color.New(color.FgRed, color.Bold).Fprintf(r.Output, "\n❌ Command ultimately failed after all fixes: %v\n", err)
+	}
+
+	if err := session.Save(); err != nil {
+		color.New(color.FgRed, color.Bold).Fprintf(r.Output, "\n❌ Failed to save repair history: %v\n", err)
 	}
 }
 
 /*
-fixAndRunCommandWithMeta attempts to execute a shell command in the specified mode (e.g., same-terminal or background).
-If the command fails, it queries OpenAI for a suggested fix, presents the fix and its explanation to the user, and prompts the user to apply the fix. If the user agrees, the fix is applied recursively until the command succeeds or the user declines further fixes. This function is central to the tool's self-healing capability, allowing for interactive troubleshooting and automated recovery from common errors.
+fixAndRunCommandWithMeta attempts to execute a shell command under opts (e.g., same-terminal, background, dry-run, or sandbox).
+If the command fails, it queries r.FixProvider for a suggested fix, presents the fix and its explanation to the user, and prompts the user to apply the fix. If the user agrees, the fix is applied recursively (in the default mode) and, once it succeeds, the original command is retried. For a sandbox step, each `docker run --rm` is a throwaway container, so a fix run on its own and the original command retried afterward would land in two different containers — anything the fix installed outside the /workspace bind mount would be gone by the time the retry started. Sandbox fixes are instead chained in front of the original command (`fix && command`) and that whole chain is retried as one command in one container, so the fix's effect is still present when the original command runs; if the fix itself needed fixing first, the chain keeps growing the same way. session accumulates the repair conversation for this step across retries, so the model can see what was already tried. This function is central to the tool's self-healing capability, allowing for interactive troubleshooting and automated recovery from common errors.
 */
-func fixAndRunCommandWithMeta(command, meta, mode string) error {
-	err := runCommandWithMode(command, mode)
+func (r *Runner) fixAndRunCommandWithMeta(command, meta string, opts execOptions, session *RepairSession) error {
+	err := r.runCommandWithMode(command, opts)
 	if err == nil {
 		return nil
 	}
-	color.New(color.FgRed, color.Bold).Printf("\n❌ Command failed: %s\n", err.Error())
-	errMsg := err.Error()
-	fix, explanation := getFixFromOpenAIWithMeta(command, errMsg, meta)
-	color.New(color.FgYellow, color.Bold).Printf("\n💡 Suggested Fix: %s\n", fix)
-	color.New(color.FgHiBlack).Printf("📝 %s\n", explanation)
-	if askYesNo(color.New(color.FgGreen, color.Bold).Sprintf("Apply this fix?")) {
-		if fixErr := fixAndRunCommandWithMeta(fix, meta, ""); fixErr == nil {
-			if mode == "background" {
-				if !waitForBinary(getBinaryName(command), 10, time.Second) {
-					color.New(color.FgRed, color.Bold).Printf("\n❌ Binary '%s' still not found after fix. Please ensure it is installed and in your PATH.\n", getBinaryName(command))
+	color.New(color.FgRed, color.Bold).Fprintf(r.Output, "\n❌ Command failed: %s\n", err.Error())
+	fix, explanation := r.getFix(session, command, err.Error(), meta)
+	session.Append(command, err.Error(), fix, explanation)
+	color.New(color.FgHiBlack).Fprintf(r.Output, "📝 %s\n", explanation)
+
+	prompt := "Apply this fix?"
+	r.promptMu.Lock()
+	color.New(color.FgGreen, color.Bold).Fprintf(r.Output, "%s (y/n): ", prompt)
+	confirmed := r.Prompter.Confirm(prompt)
+	r.promptMu.Unlock()
+
+	if confirmed {
+		if opts.Mode == "sandbox" {
+			// Running the fix and retrying command as two separate
+			// `docker run --rm` invocations would lose anything the fix
+			// installed outside /workspace once its container was thrown
+			// away. Chaining them into one command keeps the fix's effect
+			// alive for the retry, all within the single container that
+			// finally runs it.
+			color.New(color.FgGreen, color.Bold).Fprintln(r.Output, "\n✅ Fix applied. Retrying in the same sandbox container...")
+			return r.fixAndRunCommandWithMeta(fix+" && "+command, meta, opts, session)
+		}
+
+		fixOpts := execOptions{Mode: "", Image: opts.Image, Network: opts.Network}
+		if fixErr := r.fixAndRunCommandWithMeta(fix, meta, fixOpts, session); fixErr == nil {
+			if opts.Mode == "background" {
+				if !r.waitForBinary(getBinaryName(command), 10, time.Second) {
+					color.New(color.FgRed, color.Bold).Fprintf(r.Output, "\n❌ Binary '%s' still not found after fix. Please ensure it is installed and in your PATH.\n", getBinaryName(command))
 					return fmt.Errorf("binary '%s' still not found after fix", getBinaryName(command))
 				}
 			}
-			color.New(color.FgGreen, color.Bold).Println("\n✅ Fix applied. Retrying original command...")
-			return fixAndRunCommandWithMeta(command, meta, mode)
+			color.New(color.FgGreen, color.Bold).Fprintln(r.Output, "\n✅ Fix applied. Retrying original command...")
+			return r.fixAndRunCommandWithMeta(command, meta, opts, session)
 		} else {
-			color.New(color.FgRed, color.Bold).Printf("\n❌ Fix command failed: %v\n", fixErr)
+			color.New(color.FgRed, color.Bold).Fprintf(r.Output, "\n❌ Fix command failed: %v\n", fixErr)
 			return fixErr
 		}
 	}
@@ -127,62 +320,62 @@ func fixAndRunCommandWithMeta(command, meta, mode string) error {
 }
 
 /*
-runCommandWithMode executes a shell command according to the specified mode.
-If the mode is 'background', the command is run using nohup so it continues running after the terminal closes, and output is redirected to a log file. The function checks for the existence of the required binary before attempting execution. In the default mode, the command is run in the current terminal session. Errors are returned if the binary is missing or the command fails. This function abstracts the details of command execution modes for the rest of the setup process.
+runCommandWithMode executes a shell command according to opts.Mode.
+"background" runs the command via nohup so it continues after the terminal closes, with output redirected to a log file, after first checking the required binary is on PATH. "dry-run" prints the resolved command without executing it, expanding only $VAR/${VAR} references via os.ExpandEnv — real execution runs the command through `bash -c`, which additionally does command substitution, parameter-expansion defaults, and quoting, so the preview is best-effort and can diverge from what actually runs for commands that lean on those. "sandbox" runs the command inside a throwaway Docker container. Anything else ("same-terminal", "") runs the command directly. Errors are returned if the binary is missing, the image is unset for sandbox mode, or the command fails.
 */
-func runCommandWithMode(command, mode string) error {
-	switch mode {
+func (r *Runner) runCommandWithMode(command string, opts execOptions) error {
+	switch opts.Mode {
 	case "background":
 		binary := getBinaryName(command)
 		if binary == "" {
 			return fmt.Errorf("could not determine binary for background command: %s", command)
 		}
-		if _, err := exec.LookPath(binary); err != nil {
+		if _, err := r.Executor.LookPath(binary); err != nil {
 			return fmt.Errorf("binary '%s' not found: %w", binary, err)
 		}
-		color.New(color.FgCyan).Printf("\n🚀 Running '%s' in background...\n", command)
+		color.New(color.FgCyan).Fprintf(r.Output, "\n🚀 Running '%s' in background...\n", command)
 		backgroundCmd := fmt.Sprintf("nohup %s > background_command.log 2>&1 &", command)
-		return runCommand(backgroundCmd, true)
+		return r.Executor.Run(backgroundCmd, true)
+	case "dry-run":
+		color.New(color.FgCyan).Fprintf(r.Output, "\n🧪 Dry run — would execute:\n  %s\n", os.ExpandEnv(command))
+		return nil
+	case "sandbox":
+		return r.runSandboxed(command, opts)
 	default:
-		return runCommand(command, false)
+		return r.Executor.Run(command, false)
 	}
 }
 
 /*
-runCommand executes a shell command using bash, with optional output suppression.
-If suppressOutput is true, both stdout and stderr are captured and not printed to the terminal; otherwise, output is streamed directly to the terminal. The function returns an error if the command fails, including any captured output for debugging. This function provides a flexible way to run shell commands and handle their output as needed by the setup process.
+runSandboxed runs command inside a throwaway `docker run --rm` container
+using opts.Image, with the current working directory bind-mounted
+read-write at /workspace. Setting opts.Network to "none" disables the
+container's network access. opts.Image is required; sandbox steps without
+one fail fast rather than silently falling back to the host.
 */
-func runCommand(command string, suppressOutput bool) error {
-	cmd := exec.Command("bash", "-c", command)
-	cmd.Stdin = os.Stdin
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	if !suppressOutput {
-		cmd.Stdout = os.Stdout
-	}
-	if err := cmd.Run(); err != nil {
-		if suppressOutput {
-			return errors.New(strings.TrimSpace(stdout.String() + "\n" + stderr.String()))
-		}
-		return errors.New(stderr.String())
+func (r *Runner) runSandboxed(command string, opts execOptions) error {
+	if opts.Image == "" {
+		return fmt.Errorf("sandbox mode requires an `image:` field for this step")
 	}
-	if !suppressOutput && stdout.Len() > 0 {
-		fmt.Print(stdout.String())
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("resolving workspace directory: %w", err)
+	}
+
+	args := []string{"docker", "run", "--rm", "-v", shellQuote(wd) + ":/workspace", "-w", "/workspace"}
+	if opts.Network == "none" {
+		args = append(args, "--network", "none")
 	}
-	return nil
+	args = append(args, opts.Image, "bash", "-c", shellQuote(command))
+
+	color.New(color.FgCyan).Fprintf(r.Output, "\n📦 Running '%s' in a %s sandbox...\n", command, opts.Image)
+	return r.Executor.Run(strings.Join(args, " "), false)
 }
 
-/*
-askYesNo prompts the user with a yes/no question and waits for input from stdin.
-The function returns true if the user responds with 'y' or 'yes' (case-insensitive), and false for any other response. This is used to confirm user intent before applying potentially impactful fixes or changes during the setup process.
-*/
-func askYesNo(prompt string) bool {
-	color.New(color.FgHiMagenta, color.Bold).Printf("%s (y/n): ", prompt)
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Scan()
-	resp := strings.ToLower(scanner.Text())
-	return resp == "y" || resp == "yes"
+// shellQuote wraps s in single quotes suitable for passing as one argument
+// to `bash -c`, escaping any embedded single quotes.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
 }
 
 /*
@@ -201,12 +394,12 @@ func getBinaryName(cmd string) string {
 waitForBinary repeatedly checks if a given binary is available in the system PATH.
 It retries up to maxTries times, waiting for the specified delay between attempts. Returns true if the binary is found within the allotted attempts, or false otherwise. This is useful for waiting on installations or updates to complete before proceeding with dependent steps.
 */
-func waitForBinary(binary string, maxTries int, delay time.Duration) bool {
+func (r *Runner) waitForBinary(binary string, maxTries int, delay time.Duration) bool {
 	for i := 0; i < maxTries; i++ {
-		if _, err := exec.LookPath(binary); err == nil {
+		if _, err := r.Executor.LookPath(binary); err == nil {
 			return true
 		}
-		time.Sleep(delay)
+		r.Clock.Sleep(delay)
 	}
 	return false
 }
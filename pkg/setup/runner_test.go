@@ -0,0 +1,265 @@
+package setup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"zup/pkg/llm"
+)
+
+// fakeExecutor is a CommandExecutor whose Run/LookPath results are scripted
+// per call, so tests never spawn a real process.
+type fakeExecutor struct {
+	runResults  []error
+	lookPathErr error
+	runCalls    []string
+}
+
+func (f *fakeExecutor) Run(command string, suppressOutput bool) error {
+	f.runCalls = append(f.runCalls, command)
+	i := len(f.runCalls) - 1
+	if i < len(f.runResults) {
+		return f.runResults[i]
+	}
+	return nil
+}
+
+func (f *fakeExecutor) LookPath(binary string) (string, error) {
+	if f.lookPathErr != nil {
+		return "", f.lookPathErr
+	}
+	return "/usr/bin/" + binary, nil
+}
+
+// fakePrompter returns a scripted sequence of yes/no answers.
+type fakePrompter struct {
+	answers []bool
+	calls   int
+}
+
+func (f *fakePrompter) Confirm(prompt string) bool {
+	if f.calls >= len(f.answers) {
+		return false
+	}
+	a := f.answers[f.calls]
+	f.calls++
+	return a
+}
+
+// fakeClock makes waitForBinary retries instant in tests.
+type fakeClock struct{ slept []time.Duration }
+
+func (f *fakeClock) Now() time.Time        { return time.Time{} }
+func (f *fakeClock) Sleep(d time.Duration) { f.slept = append(f.slept, d) }
+
+// fakeFixProvider returns a scripted fix without ever contacting a real
+// backend.
+type fakeFixProvider struct {
+	fix         string
+	explanation string
+	err         error
+}
+
+func (f *fakeFixProvider) GetFix(ctx context.Context, req llm.FixRequest) (llm.FixResult, error) {
+	if f.err != nil {
+		return llm.FixResult{}, f.err
+	}
+	return llm.FixResult{Fix: f.fix, Explanation: f.explanation}, nil
+}
+
+func newTestRunner(exec *fakeExecutor, prompter *fakePrompter, provider llm.FixProvider) *Runner {
+	return &Runner{
+		Executor:    exec,
+		Prompter:    prompter,
+		FixProvider: provider,
+		Output:      &bytes.Buffer{},
+		Clock:       &fakeClock{},
+		NoStream:    true,
+		promptMu:    &sync.Mutex{},
+		outputMu:    &sync.Mutex{},
+	}
+}
+
+func TestFixAndRunCommandWithMeta(t *testing.T) {
+	tests := []struct {
+		name         string
+		runResults   []error
+		answers      []bool
+		wantErr      bool
+		wantRunCalls int
+	}{
+		{
+			name:         "succeeds on first try, no fix needed",
+			runResults:   []error{nil},
+			wantErr:      false,
+			wantRunCalls: 1,
+		},
+		{
+			name:         "fails, user declines fix, error is returned",
+			runResults:   []error{errors.New("command not found")},
+			answers:      []bool{false},
+			wantErr:      true,
+			wantRunCalls: 1,
+		},
+		{
+			name:         "fails, user applies fix, retry succeeds",
+			runResults:   []error{errors.New("command not found"), nil, nil},
+			answers:      []bool{true},
+			wantErr:      false,
+			wantRunCalls: 3,
+		},
+		{
+			name:         "fails, fix applied but fix command itself fails",
+			runResults:   []error{errors.New("boom"), errors.New("fix failed")},
+			answers:      []bool{true},
+			wantErr:      true,
+			wantRunCalls: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exec := &fakeExecutor{runResults: tt.runResults}
+			prompter := &fakePrompter{answers: tt.answers}
+			provider := &fakeFixProvider{fix: "apt-get install foo", explanation: "installs foo"}
+			r := newTestRunner(exec, prompter, provider)
+
+			session := NewRepairSession(Step{Desc: "test step", Cmd: "foo"})
+			err := r.fixAndRunCommandWithMeta("foo", "", execOptions{Mode: "same-terminal"}, session)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got err %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(exec.runCalls) != tt.wantRunCalls {
+				t.Fatalf("got %d Run calls, want %d: %v", len(exec.runCalls), tt.wantRunCalls, exec.runCalls)
+			}
+		})
+	}
+}
+
+func TestFixAndRunCommandWithMeta_BackgroundModeWaitsForBinary(t *testing.T) {
+	exec := &fakeExecutor{
+		runResults:  []error{errors.New("not found"), nil},
+		lookPathErr: nil,
+	}
+	prompter := &fakePrompter{answers: []bool{true}}
+	provider := &fakeFixProvider{fix: "install-thing", explanation: "installs the thing"}
+	r := newTestRunner(exec, prompter, provider)
+
+	session := NewRepairSession(Step{Desc: "bg step", Cmd: "install-thing"})
+	err := r.fixAndRunCommandWithMeta("thing serve", "", execOptions{Mode: "background"}, session)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFixAndRunCommandWithMeta_BackgroundModeBinaryNeverAppears(t *testing.T) {
+	// The fix itself runs fine, but the binary it was supposed to install
+	// never shows up on PATH, so waitForBinary should exhaust its retries.
+	exec := &fakeExecutor{
+		runResults:  []error{nil},
+		lookPathErr: fmt.Errorf("not on PATH"),
+	}
+	prompter := &fakePrompter{answers: []bool{true}}
+	provider := &fakeFixProvider{fix: "install-thing", explanation: "installs the thing"}
+	r := newTestRunner(exec, prompter, provider)
+
+	session := NewRepairSession(Step{Desc: "bg step", Cmd: "thing serve"})
+	err := r.fixAndRunCommandWithMeta("thing serve", "", execOptions{Mode: "background"}, session)
+	if err == nil {
+		t.Fatal("expected an error when the binary never appears on PATH")
+	}
+}
+
+func TestFixAndRunCommandWithMeta_SandboxModeFixAndRetryShareContainer(t *testing.T) {
+	// Only two Run calls are expected: the original command's failing
+	// attempt, then ONE retry that chains the fix in front of the original
+	// command so both run in the same throwaway container. A fix that ran
+	// in its own container before the original command retried in a fresh
+	// one would never actually persist (e.g. a package install would be
+	// gone by the time the retry's container started).
+	exec := &fakeExecutor{runResults: []error{errors.New("missing lib"), nil}}
+	prompter := &fakePrompter{answers: []bool{true}}
+	provider := &fakeFixProvider{fix: "apt-get install -y libfoo", explanation: "installs libfoo"}
+	r := newTestRunner(exec, prompter, provider)
+
+	session := NewRepairSession(Step{Desc: "sandbox step", Cmd: "foo"})
+	opts := execOptions{Mode: "sandbox", Image: "ubuntu:22.04", Network: "none"}
+	err := r.fixAndRunCommandWithMeta("foo", "", opts, session)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(exec.runCalls) != 2 {
+		t.Fatalf("got %d Run calls, want 2: %v", len(exec.runCalls), exec.runCalls)
+	}
+	retry := exec.runCalls[1]
+	if !strings.Contains(retry, "docker run") || !strings.Contains(retry, "ubuntu:22.04") {
+		t.Fatalf("retry should have run inside the step's sandbox, got: %s", retry)
+	}
+	if !strings.Contains(retry, "apt-get install -y libfoo && foo") {
+		t.Fatalf("fix and original command should be chained in the same container invocation, got: %s", retry)
+	}
+}
+
+// fakeStreamingFixProvider is a llm.StreamingFixProvider that counts whether
+// a caller used the streaming or blocking path.
+type fakeStreamingFixProvider struct {
+	fix, explanation        string
+	streamCalls, blockCalls int
+}
+
+func (f *fakeStreamingFixProvider) GetFix(ctx context.Context, req llm.FixRequest) (llm.FixResult, error) {
+	f.blockCalls++
+	return llm.FixResult{Fix: f.fix, Explanation: f.explanation}, nil
+}
+
+func (f *fakeStreamingFixProvider) GetFixStream(ctx context.Context, req llm.FixRequest, onDelta func(llm.StreamDelta)) (llm.FixResult, error) {
+	f.streamCalls++
+	onDelta(llm.StreamDelta{Fix: f.fix})
+	return llm.FixResult{Fix: f.fix, Explanation: f.explanation}, nil
+}
+
+func TestGetFix_GroupedStepSkipsStreaming(t *testing.T) {
+	provider := &fakeStreamingFixProvider{fix: "apt-get install foo", explanation: "installs foo"}
+	r := newTestRunner(&fakeExecutor{}, &fakePrompter{}, provider)
+	r.NoStream = false // streaming would normally be preferred
+
+	var buf bytes.Buffer
+	grouped := r.withOutput(&prefixWriter{out: &buf, prefix: "[step]", mu: r.outputMu})
+
+	session := NewRepairSession(Step{Desc: "step", Cmd: "foo"})
+	fix, explanation := grouped.getFix(session, "foo", "boom", "")
+
+	if provider.streamCalls != 0 {
+		t.Fatalf("grouped getFix should not use streaming, got %d stream calls", provider.streamCalls)
+	}
+	if provider.blockCalls != 1 {
+		t.Fatalf("grouped getFix should use the blocking GetFix once, got %d", provider.blockCalls)
+	}
+	if fix != "apt-get install foo" || explanation != "installs foo" {
+		t.Fatalf("got fix %q explanation %q", fix, explanation)
+	}
+}
+
+func TestFixAndRunCommandWithMeta_RecordsRepairHistory(t *testing.T) {
+	exec := &fakeExecutor{runResults: []error{errors.New("nope")}}
+	prompter := &fakePrompter{answers: []bool{false}}
+	provider := &fakeFixProvider{fix: "try-this", explanation: "because reasons"}
+	r := newTestRunner(exec, prompter, provider)
+
+	session := NewRepairSession(Step{Desc: "history step", Cmd: "foo"})
+	_ = r.fixAndRunCommandWithMeta("foo", "", execOptions{Mode: "same-terminal"}, session)
+
+	if len(session.Messages) != 2 {
+		t.Fatalf("expected one user/assistant pair recorded, got %d messages", len(session.Messages))
+	}
+	if session.Messages[0].Role != "user" || session.Messages[1].Role != "assistant" {
+		t.Fatalf("unexpected message roles: %+v", session.Messages)
+	}
+}
@@ -0,0 +1,113 @@
+package setup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"zup/pkg/llm"
+)
+
+// historyDir is where per-step repair conversations are persisted.
+const historyDir = ".zup/history"
+
+// maxHistoryRunes bounds how much conversation a RepairSession keeps, as a
+// rough proxy for a model's context window (about 4 runes per token). Once
+// exceeded, the oldest user/assistant pair is dropped.
+const maxHistoryRunes = 8000 * 4
+
+// RepairSession holds the running repair conversation for a single setup
+// step, threaded through the recursive fixAndRunCommandWithMeta chain so a
+// retried fix can see what was already tried instead of starting over each
+// time.
+type RepairSession struct {
+	StepHash string        `json:"step_hash"`
+	Messages []llm.Message `json:"messages"`
+}
+
+// stepHash derives a stable identifier for step from its description and
+// command, used to name its history file under .zup/history/.
+func stepHash(step Step) string {
+	sum := sha256.Sum256([]byte(step.Desc + "\x00" + step.Cmd))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// sessionPath returns the history file path for a step hash.
+func sessionPath(hash string) string {
+	return filepath.Join(historyDir, hash+".json")
+}
+
+// NewRepairSession starts a fresh, empty session for step.
+func NewRepairSession(step Step) *RepairSession {
+	return &RepairSession{StepHash: stepHash(step)}
+}
+
+// LoadRepairSession reads step's previously persisted session, if any. It
+// returns a fresh session when none is found, so callers can use it
+// unconditionally.
+func LoadRepairSession(step Step) (*RepairSession, error) {
+	hash := stepHash(step)
+	data, err := os.ReadFile(sessionPath(hash))
+	if os.IsNotExist(err) {
+		return NewRepairSession(step), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s RepairSession
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Append records one repair turn: the failure that was just seen, followed
+// by the fix the model suggested in response. Oldest turns are dropped
+// first once the conversation exceeds maxHistoryRunes.
+//
+// The current attempt's command/error are already rendered into the prompt
+// sent alongside this history (see chatMessages), so the first failure in a
+// session is recorded here in full for the *next* turn's benefit. Every
+// later failure in the same session is the direct result of a fix this
+// session already suggested, so it's recorded as "that fix produced this
+// new error" instead of restating the command/error chatMessages is about
+// to send again — otherwise the model sees the same command/error twice
+// with no signal that the previous fix was the thing that failed.
+func (s *RepairSession) Append(command, errMsg, fix, explanation string) {
+	userMsg := fmt.Sprintf("I ran this command: %s\nIt failed with this error: %s", command, errMsg)
+	if len(s.Messages) > 0 {
+		userMsg = fmt.Sprintf("That fix produced this new error: %s", errMsg)
+	}
+	s.Messages = append(s.Messages,
+		llm.Message{Role: "user", Content: userMsg},
+		llm.Message{Role: "assistant", Content: fmt.Sprintf("I suggested: %s\n%s", fix, explanation)},
+	)
+	s.trim()
+}
+
+func (s *RepairSession) trim() {
+	total := 0
+	for _, m := range s.Messages {
+		total += len([]rune(m.Content))
+	}
+	for total > maxHistoryRunes && len(s.Messages) > 2 {
+		total -= len([]rune(s.Messages[0].Content)) + len([]rune(s.Messages[1].Content))
+		s.Messages = s.Messages[2:]
+	}
+}
+
+// Save persists the session to .zup/history/<step-hash>.json so a later
+// `zup run --resume` or `zup explain` can pick it back up.
+func (s *RepairSession) Save() error {
+	if err := os.MkdirAll(historyDir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sessionPath(s.StepHash), data, 0o644)
+}